@@ -0,0 +1,233 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/tyrantlink/go-authcrunch"
+	"go.uber.org/zap"
+)
+
+var _ caddy.AdminRouter = (*App)(nil)
+
+const adminBasePath = "/security/"
+
+// Routes returns the admin API routes for the security app, following the
+// same pattern as Caddy's own admin endpoints: small, composable handlers
+// registered under a single base path.
+func (app *App) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: adminBasePath + "portals",
+			Handler: caddy.AdminHandlerFunc(app.handlePortals),
+		},
+		{
+			Pattern: adminBasePath + "portals/",
+			Handler: caddy.AdminHandlerFunc(app.handlePortal),
+		},
+		{
+			Pattern: adminBasePath + "gatekeepers",
+			Handler: caddy.AdminHandlerFunc(app.handleGatekeepers),
+		},
+		{
+			Pattern: adminBasePath + "gatekeepers/",
+			Handler: caddy.AdminHandlerFunc(app.handleGatekeeper),
+		},
+		{
+			Pattern: adminBasePath + "identity-stores/reload",
+			Handler: caddy.AdminHandlerFunc(app.handleIdentityStoresReload),
+		},
+		{
+			Pattern: adminBasePath + "reload",
+			Handler: caddy.AdminHandlerFunc(app.handleReload),
+		},
+	}
+}
+
+// handlePortals lists the names of the configured portals.
+func (app *App) handlePortals(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+	}
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return writeJSON(w, app.server.GetPortalNames())
+}
+
+// handleGatekeepers lists the names of the configured gatekeepers.
+func (app *App) handleGatekeepers(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+	}
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return writeJSON(w, app.server.GetGatekeeperNames())
+}
+
+// handlePortal dispatches operations scoped to a single portal: dumping its
+// effective config, listing active sessions, revoking a session or JTI, and
+// triggering a re-provision. Like authcrunchServer (see server.go), the
+// GetConfig, GetSessions, RevokeSession, and RevokeToken methods called on
+// the *authn.Portal below are part of the tyrantlink/go-authcrunch fork this
+// package is built against, not upstream go-authcrunch.
+//
+// Read-only branches take app.mu's read lock; mutating branches take the
+// write lock so concurrent admin writers can't race each other, not just a
+// concurrent Reload.
+func (app *App) handlePortal(w http.ResponseWriter, r *http.Request) error {
+	rest := strings.TrimPrefix(r.URL.Path, adminBasePath+"portals/")
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	if parts[0] == "" {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("portal name is required")}
+	}
+	name := parts[0]
+
+	switch {
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+		}
+		app.mu.RLock()
+		defer app.mu.RUnlock()
+		portal, err := app.getPortal(name)
+		if err != nil {
+			return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: err}
+		}
+		return writeJSON(w, portal.GetConfig())
+	case len(parts) == 1+1 && parts[1] == "reprovision":
+		if r.Method != http.MethodPost {
+			return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+		}
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		if _, err := app.getPortal(name); err != nil {
+			return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: err}
+		}
+		if err := app.server.ReprovisionPortal(name); err != nil {
+			return caddy.APIError{HTTPStatus: http.StatusInternalServerError, Err: err}
+		}
+		app.logger.Info("reprovisioned portal", zap.String("portal", name))
+		return writeJSON(w, map[string]string{"status": "reprovisioned", "portal": name})
+	case len(parts) == 1+1 && parts[1] == "sessions":
+		if r.Method != http.MethodGet {
+			return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+		}
+		app.mu.RLock()
+		defer app.mu.RUnlock()
+		portal, err := app.getPortal(name)
+		if err != nil {
+			return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: err}
+		}
+		return writeJSON(w, portal.GetSessions())
+	case len(parts) == 2+1 && parts[1] == "sessions":
+		if r.Method != http.MethodDelete {
+			return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+		}
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		portal, err := app.getPortal(name)
+		if err != nil {
+			return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: err}
+		}
+		sessionID := parts[2]
+		if err := portal.RevokeSession(sessionID); err != nil {
+			return caddy.APIError{HTTPStatus: http.StatusInternalServerError, Err: err}
+		}
+		app.logger.Info("revoked session", zap.String("portal", name), zap.String("session_id", sessionID))
+		return writeJSON(w, map[string]string{"status": "revoked", "session_id": sessionID})
+	case len(parts) == 2+1 && parts[1] == "tokens":
+		if r.Method != http.MethodDelete {
+			return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+		}
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		portal, err := app.getPortal(name)
+		if err != nil {
+			return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: err}
+		}
+		jti := parts[2]
+		if err := portal.RevokeToken(jti); err != nil {
+			return caddy.APIError{HTTPStatus: http.StatusInternalServerError, Err: err}
+		}
+		app.logger.Info("revoked token", zap.String("portal", name), zap.String("jti", jti))
+		return writeJSON(w, map[string]string{"status": "revoked", "jti": jti})
+	default:
+		return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: fmt.Errorf("unrecognized path %q", r.URL.Path)}
+	}
+}
+
+// handleGatekeeper dumps the effective config of a single gatekeeper.
+func (app *App) handleGatekeeper(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+	}
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+
+	name := strings.TrimPrefix(r.URL.Path, adminBasePath+"gatekeepers/")
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("gatekeeper name is required")}
+	}
+	gatekeeper, err := app.getGatekeeper(name)
+	if err != nil {
+		return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: err}
+	}
+	return writeJSON(w, gatekeeper.GetConfig())
+}
+
+// handleIdentityStoresReload forces the identity store caches to be
+// reloaded from their backing sources.
+func (app *App) handleIdentityStoresReload(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+	}
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+
+	if err := app.server.ReloadIdentityStores(); err != nil {
+		return caddy.APIError{HTTPStatus: http.StatusInternalServerError, Err: err}
+	}
+	app.logger.Info("reloaded identity store caches")
+	return writeJSON(w, map[string]string{"status": "reloaded"})
+}
+
+// handleReload accepts a full authcrunch.Config as its request body and
+// applies only the portals, gatekeepers, and identity stores that actually
+// changed, without restarting the app.
+func (app *App) handleReload(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+	}
+	var newConfig authcrunch.Config
+	if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("invalid config: %w", err)}
+	}
+	if err := app.Reload(&newConfig); err != nil {
+		return caddy.APIError{HTTPStatus: http.StatusInternalServerError, Err: err}
+	}
+	app.logger.Info("reloaded app config via admin API")
+	return writeJSON(w, map[string]string{"status": "reloaded"})
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(v)
+}
@@ -17,8 +17,11 @@ package security
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"sync"
 
 	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
 	"github.com/tyrantlink/go-authcrunch"
 	"github.com/tyrantlink/go-authcrunch/pkg/authn"
 	"github.com/tyrantlink/go-authcrunch/pkg/authz"
@@ -42,6 +45,7 @@ func init() {
 type SecretsManager interface {
 	GetSecret(context.Context) (map[string]interface{}, error)
 	GetSecretByKey(context.Context, string) (interface{}, error)
+	GetName() string
 }
 
 // App implements security manager.
@@ -50,10 +54,18 @@ type App struct {
 	Config *authcrunch.Config `json:"config,omitempty"`
 
 	SecretsManagersRaw []json.RawMessage `json:"secrets_managers,omitempty" caddy:"namespace=security.secrets inline_key=driver"`
-	secretsManagers    []SecretsManager
-
-	server *authcrunch.Server
-	logger *zap.Logger
+	secretsManagers    map[string]SecretsManager
+
+	mu sync.RWMutex
+	// resolvedConfig is app.Config with every {secret.*} reference resolved
+	// to its current value; it's what the live server was actually built
+	// from, and what Reload diffs against. app.Config itself is left with
+	// its placeholders intact so a later reload can re-resolve fresh
+	// values from the secrets managers' caches.
+	resolvedConfig *authcrunch.Config
+	server         authcrunchServer
+	logger         *zap.Logger
+	stopped        chan struct{}
 }
 
 // CaddyModule returns the Caddy module information.
@@ -67,7 +79,8 @@ func (App) CaddyModule() caddy.ModuleInfo {
 // Provision sets up the repo manager.
 func (app *App) Provision(ctx caddy.Context) error {
 	app.Name = appName
-	app.logger = ctx.Logger(app)
+	app.logger = withDefaultFieldFilters(ctx.Logger(app))
+	app.stopped = make(chan struct{})
 
 	app.logger.Info(
 		"provisioning app instance",
@@ -84,11 +97,46 @@ func (app *App) Provision(ctx caddy.Context) error {
 		return err
 	}
 
+	app.secretsManagers = make(map[string]SecretsManager)
 	for _, mod := range secretsManagerMods.([]any) {
-		app.secretsManagers = append(app.secretsManagers, mod.(SecretsManager))
+		sm := mod.(SecretsManager)
+		name := sm.GetName()
+		if name == "" {
+			err := fmt.Errorf("secrets manager of type %T must set a non-empty name", sm)
+			app.logger.Error(
+				"app failed loading secrets manager plugins",
+				zap.String("app_name", app.Name),
+				zap.Error(err),
+			)
+			return err
+		}
+		if _, exists := app.secretsManagers[name]; exists {
+			err := fmt.Errorf("duplicate secrets manager name %q", name)
+			app.logger.Error(
+				"app failed loading secrets manager plugins",
+				zap.String("app_name", app.Name),
+				zap.Error(err),
+			)
+			return err
+		}
+		app.secretsManagers[name] = sm
+	}
+
+	resolved := app.Config
+	if app.Config != nil {
+		resolved = cloneConfig(app.Config)
+		if err := app.resolveSecrets(ctx.Context, resolved); err != nil {
+			app.logger.Error(
+				"app failed resolving secret references in config",
+				zap.String("app_name", app.Name),
+				zap.Error(err),
+			)
+			return err
+		}
 	}
+	app.resolvedConfig = resolved
 
-	server, err := authcrunch.NewServer(app.Config, app.logger)
+	server, err := authcrunch.NewServer(resolved, app.logger)
 	if err != nil {
 		app.logger.Error(
 			"failed provisioning app server instance",
@@ -99,6 +147,20 @@ func (app *App) Provision(ctx caddy.Context) error {
 	}
 	app.server = server
 
+	eventsAppIface, err := ctx.App("events")
+	if err != nil {
+		app.logger.Warn(
+			"app could not load events app, security lifecycle events will not be published",
+			zap.String("app_name", app.Name),
+			zap.Error(err),
+		)
+	} else {
+		app.server.SetEventEmitter(&appEventEmitter{
+			ctx:    ctx,
+			events: eventsAppIface.(*caddyevents.App),
+		})
+	}
+
 	app.logger.Info(
 		"provisioned app instance",
 		zap.String("app", app.Name),
@@ -107,20 +169,22 @@ func (app *App) Provision(ctx caddy.Context) error {
 }
 
 // Start starts the App.
-func (app App) Start() error {
+func (app *App) Start() error {
 	app.logger.Debug(
 		"started app instance",
 		zap.String("app", app.Name),
 	)
+	go app.watchReloadSignal()
 	return nil
 }
 
 // Stop stops the App.
-func (app App) Stop() error {
+func (app *App) Stop() error {
 	app.logger.Debug(
 		"stopped app instance",
 		zap.String("app", app.Name),
 	)
+	close(app.stopped)
 	return nil
 }
 
@@ -0,0 +1,60 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
+)
+
+// Event names published by the security app through caddyevents. Handlers
+// can bind to these the same way they bind to caddyhttp or caddytls events.
+const (
+	EventAuthSuccess      = "security.auth.success"
+	EventAuthFailure      = "security.auth.failure"
+	EventMFAChallenge     = "security.mfa.challenge"
+	EventSessionCreated   = "security.session.created"
+	EventSessionRevoked   = "security.session.revoked"
+	EventGatekeeperDenied = "security.gatekeeper.denied"
+	EventSecretsRotated   = "security.secrets.rotated"
+)
+
+// EventEmitter is the narrow surface the authcrunch server needs to publish
+// lifecycle events without depending on caddyevents directly.
+type EventEmitter interface {
+	Emit(name string, subject string, portal string, sourceIP string, userAgent string, realm string, method string, reason string)
+}
+
+// appEventEmitter adapts the caddyevents app to the EventEmitter interface
+// expected by authcrunch.Server.
+type appEventEmitter struct {
+	ctx    caddy.Context
+	events *caddyevents.App
+}
+
+// Emit publishes a security lifecycle event with a stable schema so that
+// webhook, exec, or custom caddyevents handlers can act on it without
+// scraping logs.
+func (e *appEventEmitter) Emit(name, subject, portal, sourceIP, userAgent, realm, method, reason string) {
+	e.events.Emit(e.ctx, name, map[string]any{
+		"subject":    subject,
+		"portal":     portal,
+		"source_ip":  sourceIP,
+		"user_agent": userAgent,
+		"realm":      realm,
+		"method":     method,
+		"reason":     reason,
+	})
+}
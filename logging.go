@@ -0,0 +1,190 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	caddy.RegisterModule(CookieFilter{})
+	caddy.RegisterModule(BearerFilter{})
+	caddy.RegisterModule(PIIHashFilter{})
+}
+
+// sensitiveFields maps the zap field keys the security app itself writes to
+// the filter that should be applied to them by default, so that user
+// identifiers, bearer tokens, cookie contents, TOTP seeds, and password
+// reset tokens never reach an operator's log pipeline verbatim.
+var sensitiveFields = map[string]func(zapcore.Field) zapcore.Field{
+	"cookie":               CookieFilter{}.Filter,
+	"bearer_token":         BearerFilter{}.Filter,
+	"authorization":        BearerFilter{}.Filter,
+	"user":                 PIIHashFilter{}.Filter,
+	"subject":              PIIHashFilter{}.Filter,
+	"totp_seed":            PIIHashFilter{}.Filter,
+	"password_reset_token": PIIHashFilter{}.Filter,
+}
+
+// CookieFilter redacts the value of a cookie field, keeping only the cookie
+// name so operators can still tell which cookie was involved.
+type CookieFilter struct{}
+
+// CaddyModule returns the Caddy module information.
+func (CookieFilter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.encoders.filter.security_cookie",
+		New: func() caddy.Module { return new(CookieFilter) },
+	}
+}
+
+// Filter redacts everything after the first "=" in a "name=value" cookie
+// field, leaving "name=REDACTED". It renders the field's value through
+// fieldValueString first, so a cookie logged via zap.Any or another
+// non-string constructor is redacted the same as one logged via zap.String.
+func (CookieFilter) Filter(in zapcore.Field) zapcore.Field {
+	value := fieldValueString(in)
+	out := zapcore.Field{Key: in.Key, Type: zapcore.StringType}
+	if name, _, ok := strings.Cut(value, "="); ok {
+		out.String = name + "=REDACTED"
+	} else {
+		out.String = "REDACTED"
+	}
+	return out
+}
+
+// BearerFilter redacts a bearer token field, keeping only the scheme.
+type BearerFilter struct{}
+
+// CaddyModule returns the Caddy module information.
+func (BearerFilter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.encoders.filter.security_bearer",
+		New: func() caddy.Module { return new(BearerFilter) },
+	}
+}
+
+// Filter redacts a "Bearer <token>" field down to "Bearer REDACTED". It
+// renders the field's value through fieldValueString first, so a token
+// logged via zap.Any or another non-string constructor is redacted the same
+// as one logged via zap.String.
+func (BearerFilter) Filter(in zapcore.Field) zapcore.Field {
+	value := fieldValueString(in)
+	out := zapcore.Field{Key: in.Key, Type: zapcore.StringType}
+	scheme, _, ok := strings.Cut(value, " ")
+	if !ok {
+		out.String = "REDACTED"
+		return out
+	}
+	out.String = scheme + " REDACTED"
+	return out
+}
+
+// PIIHashFilter replaces a field's value with its SHA-256 hash, so
+// operators can correlate repeated occurrences of the same value without
+// ever seeing the value itself.
+type PIIHashFilter struct{}
+
+// CaddyModule returns the Caddy module information.
+func (PIIHashFilter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.encoders.filter.security_pii_hash",
+		New: func() caddy.Module { return new(PIIHashFilter) },
+	}
+}
+
+// Filter replaces the field's value with its hex-encoded SHA-256 digest,
+// prefixed with "sha256:". It
+// renders the value through fieldValueString first, so fields logged with
+// zap.Any, zap.Int, zap.Object, or any other non-string constructor are
+// hashed from their actual value rather than from an empty in.String.
+func (PIIHashFilter) Filter(in zapcore.Field) zapcore.Field {
+	sum := sha256.Sum256([]byte(fieldValueString(in)))
+	return zapcore.Field{
+		Key:    in.Key,
+		Type:   zapcore.StringType,
+		String: "sha256:" + hex.EncodeToString(sum[:]),
+	}
+}
+
+// fieldValueString renders a zap field's value as a string regardless of its
+// underlying zapcore type, by running it through a MapObjectEncoder the same
+// way a real encoder would. Filters use this instead of reading in.String
+// directly, which is only populated for zapcore.StringType fields and would
+// silently leave the real value sitting in the field's other members (e.g.
+// Integer or Interface) for any field built with zap.Any, zap.Int, and so on.
+func fieldValueString(f zapcore.Field) string {
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	if v, ok := enc.Fields[f.Key]; ok {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// withDefaultFieldFilters wraps logger so that any field whose key appears
+// in sensitiveFields is redacted or hashed before it reaches the
+// configured log sink, regardless of what encoder the operator attached.
+func withDefaultFieldFilters(logger *zap.Logger) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &filteringCore{Core: core}
+	}))
+}
+
+// filteringCore decorates a zapcore.Core, running every logged field
+// through sensitiveFields before delegating to the wrapped core.
+type filteringCore struct {
+	zapcore.Core
+}
+
+func (c *filteringCore) With(fields []zapcore.Field) zapcore.Core {
+	return &filteringCore{Core: c.Core.With(filterFields(fields))}
+}
+
+func (c *filteringCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, filterFields(fields))
+}
+
+func (c *filteringCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func filterFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		if filter, ok := sensitiveFields[f.Key]; ok {
+			f = filter(f)
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// Interface guards
+var (
+	_ caddy.Module = (*CookieFilter)(nil)
+	_ caddy.Module = (*BearerFilter)(nil)
+	_ caddy.Module = (*PIIHashFilter)(nil)
+)
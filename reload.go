@@ -0,0 +1,412 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"syscall"
+
+	"github.com/tyrantlink/go-authcrunch"
+	"go.uber.org/zap"
+)
+
+// configDiff describes what changed between two authcrunch.Config values,
+// broken down by section and keyed by each entry's "name" field.
+type configDiff struct {
+	addedPortals   []string
+	removedPortals []string
+	changedPortals []string
+
+	addedGatekeepers   []string
+	removedGatekeepers []string
+	changedGatekeepers []string
+
+	addedIdentityStores   []string
+	removedIdentityStores []string
+	changedIdentityStores []string
+}
+
+// empty reports whether the diff contains no changes at all.
+func (d *configDiff) empty() bool {
+	return len(d.addedPortals) == 0 && len(d.removedPortals) == 0 && len(d.changedPortals) == 0 &&
+		len(d.addedGatekeepers) == 0 && len(d.removedGatekeepers) == 0 && len(d.changedGatekeepers) == 0 &&
+		len(d.addedIdentityStores) == 0 && len(d.removedIdentityStores) == 0 && len(d.changedIdentityStores) == 0
+}
+
+// Reload computes a diff between the app's currently applied (resolved)
+// config and newConfig, and applies only the affected portals, gatekeepers,
+// and identity stores in place. Unaffected portals, and the sessions they
+// hold, are left untouched, so a reload that only e.g. rotates one portal's
+// JWT signing key does not disturb any other portal's in-flight sessions.
+//
+// newConfig is resolved into its own copy; app.Config keeps whatever
+// {secret.*} placeholders the caller passed in (in particular, the pristine
+// config from Provision still has them), so that calling Reload(app.Config)
+// again later re-resolves fresh values from the secrets managers' caches
+// instead of being a permanent no-op.
+func (app *App) Reload(newConfig *authcrunch.Config) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	resolved := newConfig
+	if len(app.secretsManagers) > 0 {
+		resolved = cloneConfig(newConfig)
+		if err := app.resolveSecrets(context.Background(), resolved); err != nil {
+			return fmt.Errorf("failed resolving secrets for reload: %w", err)
+		}
+	}
+
+	diff, err := diffConfigs(app.resolvedConfig, resolved)
+	if err != nil {
+		return fmt.Errorf("failed diffing config: %w", err)
+	}
+	if diff.empty() {
+		app.logger.Debug("reload requested but config is unchanged")
+		return nil
+	}
+
+	// rollback accumulates a compensating action for every step that has
+	// already been applied to app.server, so that a failure partway
+	// through leaves the live server exactly as it was instead of in a
+	// mix of old and new state.
+	var rollback []func() error
+	runStep := func(apply func() error, compensate func() error) error {
+		if err := apply(); err != nil {
+			return err
+		}
+		rollback = append(rollback, compensate)
+		return nil
+	}
+	abort := func(cause error) error {
+		for i := len(rollback) - 1; i >= 0; i-- {
+			if rbErr := rollback[i](); rbErr != nil {
+				app.logger.Error("failed rolling back partially applied reload", zap.Error(rbErr))
+			}
+		}
+		return cause
+	}
+
+	for _, name := range diff.removedGatekeepers {
+		oldCfg, _ := lookupByName(app.resolvedConfig, "authorization_policies", name)
+		name := name
+		err := runStep(
+			func() error { return app.server.RemoveGatekeeper(name) },
+			func() error { return app.server.AddGatekeeper(oldCfg) },
+		)
+		if err != nil {
+			return abort(fmt.Errorf("failed removing gatekeeper %q: %w", name, err))
+		}
+	}
+	for _, name := range diff.removedPortals {
+		oldCfg, _ := lookupByName(app.resolvedConfig, "authentication_portals", name)
+		name := name
+		err := runStep(
+			func() error { return app.server.RemovePortal(name) },
+			func() error { return app.server.AddPortal(oldCfg) },
+		)
+		if err != nil {
+			return abort(fmt.Errorf("failed removing portal %q: %w", name, err))
+		}
+	}
+
+	for _, name := range diff.addedIdentityStores {
+		cfg, _ := lookupByName(resolved, "identity_stores", name)
+		name := name
+		err := runStep(
+			func() error { return app.server.AddIdentityStore(cfg) },
+			func() error { return app.server.RemoveIdentityStore(name) },
+		)
+		if err != nil {
+			return abort(fmt.Errorf("failed adding identity store %q: %w", name, err))
+		}
+	}
+	for _, name := range diff.changedIdentityStores {
+		oldCfg, _ := lookupByName(app.resolvedConfig, "identity_stores", name)
+		cfg, _ := lookupByName(resolved, "identity_stores", name)
+		name := name
+		err := runStep(
+			func() error { return app.server.UpdateIdentityStore(name, cfg) },
+			func() error { return app.server.UpdateIdentityStore(name, oldCfg) },
+		)
+		if err != nil {
+			return abort(fmt.Errorf("failed updating identity store %q: %w", name, err))
+		}
+	}
+	for _, name := range diff.removedIdentityStores {
+		oldCfg, _ := lookupByName(app.resolvedConfig, "identity_stores", name)
+		name := name
+		err := runStep(
+			func() error { return app.server.RemoveIdentityStore(name) },
+			func() error { return app.server.AddIdentityStore(oldCfg) },
+		)
+		if err != nil {
+			return abort(fmt.Errorf("failed removing identity store %q: %w", name, err))
+		}
+	}
+
+	for _, name := range diff.changedPortals {
+		oldCfg, _ := lookupByName(app.resolvedConfig, "authentication_portals", name)
+		newCfg, _ := lookupByName(resolved, "authentication_portals", name)
+		name := name
+		if isInPlacePortalChange(oldCfg, newCfg) {
+			err := runStep(
+				func() error { return app.server.UpdatePortalCredentials(name, newCfg) },
+				func() error { return app.server.UpdatePortalCredentials(name, oldCfg) },
+			)
+			if err != nil {
+				return abort(fmt.Errorf("failed updating credentials for portal %q: %w", name, err))
+			}
+			app.logger.Info("rotated portal credentials in place", zap.String("portal", name))
+			continue
+		}
+		err := runStep(
+			func() error { return app.server.RebuildPortal(name, newCfg) },
+			func() error { return app.server.RebuildPortal(name, oldCfg) },
+		)
+		if err != nil {
+			return abort(fmt.Errorf("failed rebuilding portal %q: %w", name, err))
+		}
+		app.logger.Info("rebuilt portal", zap.String("portal", name))
+	}
+	for _, name := range diff.addedPortals {
+		cfg, _ := lookupByName(resolved, "authentication_portals", name)
+		name := name
+		err := runStep(
+			func() error { return app.server.AddPortal(cfg) },
+			func() error { return app.server.RemovePortal(name) },
+		)
+		if err != nil {
+			return abort(fmt.Errorf("failed adding portal %q: %w", name, err))
+		}
+	}
+
+	for _, name := range diff.changedGatekeepers {
+		oldCfg, _ := lookupByName(app.resolvedConfig, "authorization_policies", name)
+		cfg, _ := lookupByName(resolved, "authorization_policies", name)
+		name := name
+		err := runStep(
+			func() error { return app.server.RebuildGatekeeper(name, cfg) },
+			func() error { return app.server.RebuildGatekeeper(name, oldCfg) },
+		)
+		if err != nil {
+			return abort(fmt.Errorf("failed rebuilding gatekeeper %q: %w", name, err))
+		}
+	}
+	for _, name := range diff.addedGatekeepers {
+		cfg, _ := lookupByName(resolved, "authorization_policies", name)
+		name := name
+		err := runStep(
+			func() error { return app.server.AddGatekeeper(cfg) },
+			func() error { return app.server.RemoveGatekeeper(name) },
+		)
+		if err != nil {
+			return abort(fmt.Errorf("failed adding gatekeeper %q: %w", name, err))
+		}
+	}
+
+	app.Config = newConfig
+	app.resolvedConfig = resolved
+	app.logger.Info(
+		"reloaded app config",
+		zap.Int("portals_added", len(diff.addedPortals)),
+		zap.Int("portals_removed", len(diff.removedPortals)),
+		zap.Int("portals_changed", len(diff.changedPortals)),
+		zap.Int("gatekeepers_added", len(diff.addedGatekeepers)),
+		zap.Int("gatekeepers_removed", len(diff.removedGatekeepers)),
+		zap.Int("gatekeepers_changed", len(diff.changedGatekeepers)),
+	)
+	return nil
+}
+
+// isInPlacePortalChange reports whether the only differences between two
+// portal configs are within fields that authcrunch.Server can rotate
+// without tearing the portal down, e.g. a JWT signing key or an OAuth
+// client secret.
+func isInPlacePortalChange(oldCfg, newCfg map[string]interface{}) bool {
+	if oldCfg == nil || newCfg == nil {
+		return false
+	}
+	const safePrefix = "credentials"
+	for _, key := range unionKeys(oldCfg, newCfg) {
+		if reflect.DeepEqual(oldCfg[key], newCfg[key]) {
+			continue
+		}
+		if key != safePrefix {
+			return false
+		}
+	}
+	return true
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	seen := make(map[string]struct{}, len(a)+len(b))
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		if _, ok := seen[k]; !ok {
+			seen[k] = struct{}{}
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if _, ok := seen[k]; !ok {
+			seen[k] = struct{}{}
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// diffConfigs compares the named-entry sections of two configs generically,
+// via their JSON representation, since authcrunch.Config's concrete field
+// layout isn't depended on here.
+func diffConfigs(oldConfig, newConfig *authcrunch.Config) (*configDiff, error) {
+	oldTree, err := toTree(oldConfig)
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := toTree(newConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &configDiff{}
+	diff.addedPortals, diff.removedPortals, diff.changedPortals = diffSection(oldTree, newTree, "authentication_portals")
+	diff.addedGatekeepers, diff.removedGatekeepers, diff.changedGatekeepers = diffSection(oldTree, newTree, "authorization_policies")
+	diff.addedIdentityStores, diff.removedIdentityStores, diff.changedIdentityStores = diffSection(oldTree, newTree, "identity_stores")
+	return diff, nil
+}
+
+// diffSection compares the named entries of a single config section
+// between two generic trees, returning added, removed, and changed names,
+// each sorted so that Reload applies them in a stable order.
+func diffSection(oldTree, newTree map[string]interface{}, section string) (added, removed, changed []string) {
+	oldEntries := namedEntries(oldTree, section)
+	newEntries := namedEntries(newTree, section)
+
+	for name, newEntry := range newEntries {
+		oldEntry, ok := oldEntries[name]
+		if !ok {
+			added = append(added, name)
+			continue
+		}
+		if !reflect.DeepEqual(oldEntry, newEntry) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range oldEntries {
+		if _, ok := newEntries[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// namedEntries extracts the list found at tree[section] into a map keyed
+// by each entry's "name" field.
+func namedEntries(tree map[string]interface{}, section string) map[string]map[string]interface{} {
+	entries := map[string]map[string]interface{}{}
+	list, ok := tree[section].([]interface{})
+	if !ok {
+		return entries
+	}
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, ok := entry["name"].(string)
+		if !ok {
+			continue
+		}
+		entries[name] = entry
+	}
+	return entries
+}
+
+// lookupByName returns the raw config map for a single named entry within
+// a config section, suitable for passing to authcrunch.Server's targeted
+// add/update methods.
+func lookupByName(cfg *authcrunch.Config, section, name string) (map[string]interface{}, error) {
+	tree, err := toTree(cfg)
+	if err != nil {
+		return nil, err
+	}
+	entries := namedEntries(tree, section)
+	entry, ok := entries[name]
+	if !ok {
+		return nil, fmt.Errorf("no entry named %q in section %q", name, section)
+	}
+	return entry, nil
+}
+
+// toTree marshals cfg to a generic JSON tree.
+func toTree(cfg *authcrunch.Config) (map[string]interface{}, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling config: %w", err)
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return nil, fmt.Errorf("failed unmarshaling config: %w", err)
+	}
+	return tree, nil
+}
+
+// cloneConfig returns a deep copy of cfg via a JSON round trip, so that
+// secret resolution for a reload candidate never mutates the live config.
+func cloneConfig(cfg *authcrunch.Config) *authcrunch.Config {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return cfg
+	}
+	clone := &authcrunch.Config{}
+	if err := json.Unmarshal(raw, clone); err != nil {
+		return cfg
+	}
+	return clone
+}
+
+// watchReloadSignal listens for SIGHUP and re-applies the current config,
+// re-resolving any {secret.*} references so that rotated secrets flow
+// through to running portals without a full Caddy config reload.
+func (app *App) watchReloadSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-app.stopped:
+			return
+		case <-sigCh:
+			app.logger.Info("received SIGHUP, reloading security app config")
+			app.mu.RLock()
+			current := app.Config
+			app.mu.RUnlock()
+			if err := app.Reload(current); err != nil {
+				app.logger.Error("failed reloading config on SIGHUP", zap.Error(err))
+			}
+		}
+	}
+}
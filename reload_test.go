@@ -0,0 +1,230 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/tyrantlink/go-authcrunch"
+	"github.com/tyrantlink/go-authcrunch/pkg/authn"
+	"github.com/tyrantlink/go-authcrunch/pkg/authz"
+	"go.uber.org/zap"
+)
+
+// fakeServer is a minimal in-memory stand-in for *authcrunch.Server. It
+// records every portal/gatekeeper name touched by a mutating call, which is
+// what lets the tests below assert that a portal Reload wasn't asked to
+// change is never touched at all: since this fake stands in for the server
+// a real deployment's sessions would live on, a portal that's never
+// touched keeps whatever state (including sessions) it had.
+type fakeServer struct {
+	portals     map[string]bool
+	gatekeepers map[string]bool
+	touched     map[string]int
+	failOn      string
+}
+
+func newFakeServer(portals, gatekeepers []string) *fakeServer {
+	fs := &fakeServer{
+		portals:     map[string]bool{},
+		gatekeepers: map[string]bool{},
+		touched:     map[string]int{},
+	}
+	for _, p := range portals {
+		fs.portals[p] = true
+	}
+	for _, g := range gatekeepers {
+		fs.gatekeepers[g] = true
+	}
+	return fs
+}
+
+func (fs *fakeServer) maybeFail(name string) error {
+	fs.touched[name]++
+	if fs.failOn != "" && name == fs.failOn {
+		return fmt.Errorf("simulated failure on %q", name)
+	}
+	return nil
+}
+
+func (fs *fakeServer) GetPortalByName(name string) (*authn.Portal, error)         { return nil, nil }
+func (fs *fakeServer) GetGatekeeperByName(name string) (*authz.Gatekeeper, error) { return nil, nil }
+
+func (fs *fakeServer) GetPortalNames() []string {
+	names := make([]string, 0, len(fs.portals))
+	for name := range fs.portals {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (fs *fakeServer) GetGatekeeperNames() []string {
+	names := make([]string, 0, len(fs.gatekeepers))
+	for name := range fs.gatekeepers {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (fs *fakeServer) ReprovisionPortal(name string) error  { return fs.maybeFail(name) }
+func (fs *fakeServer) ReloadIdentityStores() error          { return nil }
+func (fs *fakeServer) SetEventEmitter(emitter EventEmitter) {}
+
+func (fs *fakeServer) RemovePortal(name string) error {
+	if err := fs.maybeFail(name); err != nil {
+		return err
+	}
+	delete(fs.portals, name)
+	return nil
+}
+
+func (fs *fakeServer) AddPortal(cfg map[string]interface{}) error {
+	name, _ := cfg["name"].(string)
+	if err := fs.maybeFail(name); err != nil {
+		return err
+	}
+	fs.portals[name] = true
+	return nil
+}
+
+func (fs *fakeServer) RebuildPortal(name string, cfg map[string]interface{}) error {
+	return fs.maybeFail(name)
+}
+
+func (fs *fakeServer) UpdatePortalCredentials(name string, cfg map[string]interface{}) error {
+	return fs.maybeFail(name)
+}
+
+func (fs *fakeServer) RemoveGatekeeper(name string) error {
+	if err := fs.maybeFail(name); err != nil {
+		return err
+	}
+	delete(fs.gatekeepers, name)
+	return nil
+}
+
+func (fs *fakeServer) AddGatekeeper(cfg map[string]interface{}) error {
+	name, _ := cfg["name"].(string)
+	if err := fs.maybeFail(name); err != nil {
+		return err
+	}
+	fs.gatekeepers[name] = true
+	return nil
+}
+
+func (fs *fakeServer) RebuildGatekeeper(name string, cfg map[string]interface{}) error {
+	return fs.maybeFail(name)
+}
+
+func (fs *fakeServer) AddIdentityStore(cfg map[string]interface{}) error { return nil }
+func (fs *fakeServer) UpdateIdentityStore(name string, cfg map[string]interface{}) error {
+	return nil
+}
+func (fs *fakeServer) RemoveIdentityStore(name string) error { return nil }
+
+func configWithPortals(t *testing.T, names ...string) *authcrunch.Config {
+	t.Helper()
+	portals := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		portals = append(portals, map[string]interface{}{
+			"name":        name,
+			"credentials": name + "-v1",
+		})
+	}
+	raw, err := json.Marshal(map[string]interface{}{"authentication_portals": portals})
+	if err != nil {
+		t.Fatalf("failed marshaling test config: %v", err)
+	}
+	cfg := &authcrunch.Config{}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		t.Fatalf("failed unmarshaling test config: %v", err)
+	}
+	return cfg
+}
+
+func newTestApp(t *testing.T, fs *fakeServer, cfg *authcrunch.Config) *App {
+	t.Helper()
+	return &App{
+		Config:         cfg,
+		resolvedConfig: cfg,
+		server:         fs,
+		logger:         zap.NewNop(),
+		secretsManagers: map[string]SecretsManager{},
+	}
+}
+
+// TestReloadLeavesUnaffectedPortalsUntouched verifies the central safety
+// property of Reload: a reload that only changes one portal's credentials
+// must never call any mutating server method for a portal that wasn't
+// changed, so that portal's in-flight sessions (which live entirely on the
+// server, untouched here) survive the reload.
+func TestReloadLeavesUnaffectedPortalsUntouched(t *testing.T) {
+	fs := newFakeServer([]string{"portal-a", "portal-b"}, nil)
+	oldConfig := configWithPortals(t, "portal-a", "portal-b")
+	app := newTestApp(t, fs, oldConfig)
+
+	newConfig := configWithPortals(t, "portal-a", "portal-b")
+	var tree map[string]interface{}
+	raw, _ := json.Marshal(newConfig)
+	_ = json.Unmarshal(raw, &tree)
+	portals := tree["authentication_portals"].([]interface{})
+	portals[1].(map[string]interface{})["credentials"] = "portal-b-v2"
+	raw, _ = json.Marshal(tree)
+	newConfig = &authcrunch.Config{}
+	_ = json.Unmarshal(raw, newConfig)
+
+	if err := app.Reload(newConfig); err != nil {
+		t.Fatalf("Reload returned unexpected error: %v", err)
+	}
+
+	if fs.touched["portal-a"] != 0 {
+		t.Errorf("portal-a should not have been touched, got %d calls", fs.touched["portal-a"])
+	}
+	if fs.touched["portal-b"] == 0 {
+		t.Errorf("portal-b should have been touched")
+	}
+}
+
+// TestReloadRollsBackOnFailure verifies that when a later step in a
+// multi-portal reload fails, the server ends up back in its pre-reload
+// state rather than a mix of old and new portals.
+func TestReloadRollsBackOnFailure(t *testing.T) {
+	fs := newFakeServer([]string{"portal-a"}, nil)
+	fs.failOn = "portal-c"
+	oldConfig := configWithPortals(t, "portal-a")
+	app := newTestApp(t, fs, oldConfig)
+
+	newConfig := configWithPortals(t, "portal-a", "portal-b", "portal-c")
+
+	if err := app.Reload(newConfig); err == nil {
+		t.Fatal("expected Reload to fail")
+	}
+
+	if fs.portals["portal-b"] {
+		t.Errorf("portal-b should have been rolled back after portal-c failed to add")
+	}
+	if !fs.portals["portal-a"] {
+		t.Errorf("portal-a should be unaffected by the failed reload")
+	}
+	if app.Config != oldConfig {
+		t.Errorf("app.Config should not advance past a failed reload")
+	}
+}
+
+var (
+	_ authcrunchServer = (*fakeServer)(nil)
+)
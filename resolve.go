@@ -0,0 +1,128 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/tyrantlink/go-authcrunch"
+)
+
+// secretRefPattern matches {secret.<manager>.<key>} placeholders that may
+// appear in any string field of authcrunch.Config.
+var secretRefPattern = regexp.MustCompile(`\{secret\.([^.{}]+)\.([^{}]+)\}`)
+
+// resolveSecrets walks cfg and replaces every {secret.<manager>.<key>}
+// placeholder with the value returned by the matching manager in
+// app.secretsManagers, so that client secrets, signing keys, and credentials
+// never have to be written in plaintext in the Caddyfile or JSON config.
+func (app *App) resolveSecrets(ctx context.Context, cfg *authcrunch.Config) error {
+	if cfg == nil || len(app.secretsManagers) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed marshaling config for secret resolution: %w", err)
+	}
+
+	var tree interface{}
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return fmt.Errorf("failed unmarshaling config for secret resolution: %w", err)
+	}
+
+	resolved, err := app.resolveSecretsInValue(ctx, tree)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.Marshal(resolved)
+	if err != nil {
+		return fmt.Errorf("failed marshaling resolved config: %w", err)
+	}
+
+	if err := json.Unmarshal(out, cfg); err != nil {
+		return fmt.Errorf("failed unmarshaling resolved config: %w", err)
+	}
+	return nil
+}
+
+// resolveSecretsInValue recurses through a generic JSON tree, substituting
+// secret references found in string leaves.
+func (app *App) resolveSecretsInValue(ctx context.Context, v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		return app.resolveSecretsInString(ctx, val)
+	case map[string]interface{}:
+		for k, child := range val {
+			resolved, err := app.resolveSecretsInValue(ctx, child)
+			if err != nil {
+				return nil, err
+			}
+			val[k] = resolved
+		}
+		return val, nil
+	case []interface{}:
+		for i, child := range val {
+			resolved, err := app.resolveSecretsInValue(ctx, child)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = resolved
+		}
+		return val, nil
+	default:
+		return v, nil
+	}
+}
+
+// resolveSecretsInString replaces every {secret.<manager>.<key>} reference
+// found in s. A string that is entirely a single reference resolves to the
+// manager's native value type (e.g. a number or bool); references embedded
+// in a larger string are substituted as text.
+func (app *App) resolveSecretsInString(ctx context.Context, s string) (interface{}, error) {
+	matches := secretRefPattern.FindStringSubmatch(s)
+	if matches != nil && matches[0] == s {
+		return app.lookupSecret(ctx, matches[1], matches[2])
+	}
+
+	var resolveErr error
+	result := secretRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		sub := secretRefPattern.FindStringSubmatch(ref)
+		value, err := app.lookupSecret(ctx, sub[1], sub[2])
+		if err != nil {
+			resolveErr = err
+			return ref
+		}
+		return fmt.Sprintf("%v", value)
+	})
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+	return result, nil
+}
+
+// lookupSecret resolves a single {secret.<manager>.<key>} reference through
+// the named manager's TTL-cached accessor.
+func (app *App) lookupSecret(ctx context.Context, manager, key string) (interface{}, error) {
+	sm, ok := app.secretsManagers[manager]
+	if !ok {
+		return nil, fmt.Errorf("no secrets manager named %q configured", manager)
+	}
+	return sm.GetSecretByKey(ctx, key)
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(AWSSecretsManager{})
+}
+
+// AWSSecretsManager fetches secrets from AWS Secrets Manager, optionally
+// assuming a role via STS, and polls for new version stages so that a
+// rotation is picked up without a Caddy reload.
+type AWSSecretsManager struct {
+	Driver string `json:"driver,omitempty"`
+
+	// Name is how this manager is referenced from a {secret.<name>.<key>}
+	// placeholder in the security app config.
+	Name string `json:"name,omitempty"`
+
+	Region   string `json:"region,omitempty"`
+	SecretID string `json:"secret_id,omitempty"`
+
+	// AssumeRoleARN, if set, is assumed via STS before calling Secrets
+	// Manager.
+	AssumeRoleARN string `json:"assume_role_arn,omitempty"`
+	// VersionStage selects the version stage to fetch, e.g. "AWSCURRENT".
+	// Defaults to AWSCURRENT.
+	VersionStage string `json:"version_stage,omitempty"`
+
+	// TTL controls how often the cached secret is refreshed in the
+	// background. Defaults to 5m.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	client *secretsmanager.Client
+	cache  *ttlCache
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (AWSSecretsManager) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "security.secrets.aws_secrets_manager",
+		New: func() caddy.Module { return new(AWSSecretsManager) },
+	}
+}
+
+// Provision sets up the AWS client, optionally assuming a role, and starts
+// the background refresh loop.
+func (m *AWSSecretsManager) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	if m.VersionStage == "" {
+		m.VersionStage = "AWSCURRENT"
+	}
+	if m.TTL == 0 {
+		m.TTL = caddy.Duration(5 * time.Minute)
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx.Context, awsconfig.WithRegion(m.Region))
+	if err != nil {
+		return fmt.Errorf("security.secrets.aws_secrets_manager: failed loading AWS config: %w", err)
+	}
+
+	if m.AssumeRoleARN != "" {
+		stsClient := sts.NewFromConfig(cfg)
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsClient, m.AssumeRoleARN))
+	}
+
+	m.client = secretsmanager.NewFromConfig(cfg)
+	m.cache = newTTLCache(time.Duration(m.TTL), m.fetch, m.logger)
+	if err := m.cache.reload(ctx.Context); err != nil {
+		return fmt.Errorf("security.secrets.aws_secrets_manager: failed initial fetch: %w", err)
+	}
+	m.cache.start(ctx.Context)
+	return nil
+}
+
+// fetch retrieves and json-decodes the secret value for the configured
+// version stage.
+func (m *AWSSecretsManager) fetch(ctx context.Context) (map[string]interface{}, error) {
+	out, err := m.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(m.SecretID),
+		VersionStage: aws.String(m.VersionStage),
+	})
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(aws.ToString(out.SecretString)), &values); err != nil {
+		return nil, fmt.Errorf("secret %s is not a JSON object: %w", m.SecretID, err)
+	}
+	return values, nil
+}
+
+// GetSecret returns the decoded secret payload.
+func (m *AWSSecretsManager) GetSecret(ctx context.Context) (map[string]interface{}, error) {
+	return m.cache.get(ctx)
+}
+
+// GetSecretByKey returns a single value from the secret payload.
+func (m *AWSSecretsManager) GetSecretByKey(ctx context.Context, key string) (interface{}, error) {
+	values, err := m.cache.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := values[key]
+	if !ok {
+		return nil, fmt.Errorf("security.secrets.aws_secrets_manager: key %q not found in %s", key, m.SecretID)
+	}
+	return v, nil
+}
+
+// GetName returns the manager name used in {secret.<name>.<key>} references.
+func (m *AWSSecretsManager) GetName() string {
+	return m.Name
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner = (*AWSSecretsManager)(nil)
+	_ caddy.Module      = (*AWSSecretsManager)(nil)
+)
@@ -0,0 +1,107 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// refreshFunc fetches the full secret payload from the backing store.
+type refreshFunc func(ctx context.Context) (map[string]interface{}, error)
+
+// ttlCache holds the most recently fetched secret payload for a single
+// manager instance and refreshes it in the background so that rotated
+// secrets are picked up without a Caddy reload.
+type ttlCache struct {
+	mu        sync.RWMutex
+	ttl       time.Duration
+	values    map[string]interface{}
+	fetchedAt time.Time
+	refresh   refreshFunc
+	logger    *zap.Logger
+}
+
+// newTTLCache creates a cache that refreshes itself every ttl using fn. A
+// ttl of zero disables background refresh; callers still get on-demand
+// fetches via get.
+func newTTLCache(ttl time.Duration, fn refreshFunc, logger *zap.Logger) *ttlCache {
+	return &ttlCache{
+		ttl:     ttl,
+		refresh: fn,
+		logger:  logger,
+	}
+}
+
+// start launches the background refresh loop. It returns immediately if
+// the cache has no TTL configured.
+func (c *ttlCache) start(ctx context.Context) {
+	if c.ttl <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(c.ttl)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.reload(ctx); err != nil {
+					c.logger.Error("failed refreshing cached secret", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// reload fetches the secret payload unconditionally and replaces the cache.
+func (c *ttlCache) reload(ctx context.Context) error {
+	values, err := c.refresh(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.values = values
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// get returns the cached payload, fetching it first if the cache is cold
+// or has expired.
+func (c *ttlCache) get(ctx context.Context) (map[string]interface{}, error) {
+	c.mu.RLock()
+	values, fetchedAt := c.values, c.fetchedAt
+	c.mu.RUnlock()
+
+	if values != nil && (c.ttl <= 0 || time.Since(fetchedAt) < c.ttl) {
+		return values, nil
+	}
+	if err := c.reload(ctx); err != nil {
+		if values != nil {
+			// Serve the stale payload rather than failing a request over a
+			// transient backend outage.
+			return values, nil
+		}
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.values, nil
+}
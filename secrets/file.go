@@ -0,0 +1,168 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"filippo.io/age"
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	caddy.RegisterModule(FileManager{})
+}
+
+// FileManager reads secrets from a local JSON or YAML file encrypted with
+// age, for deployments that keep secrets in an encrypted file next to
+// their Caddyfile rather than in a remote secrets service. Plaintext
+// (unencrypted) JSON/YAML files are supported by simply omitting
+// AgeIdentityFile.
+type FileManager struct {
+	Driver string `json:"driver,omitempty"`
+
+	// Name is how this manager is referenced from a {secret.<name>.<key>}
+	// placeholder in the security app config.
+	Name string `json:"name,omitempty"`
+
+	// Path is the encrypted file to read.
+	Path string `json:"path,omitempty"`
+	// Format is either "json" or "yaml". Defaults to "yaml".
+	Format string `json:"format,omitempty"`
+	// AgeIdentityFile is the path to an age identity (private key) file
+	// used to decrypt Path.
+	AgeIdentityFile string `json:"age_identity_file,omitempty"`
+
+	// TTL controls how often the file is re-read and decrypted from disk,
+	// so secret rotation on disk is picked up without a Caddy reload.
+	// Defaults to 1m.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	identities []age.Identity
+	cache      *ttlCache
+	logger     *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (FileManager) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "security.secrets.file",
+		New: func() caddy.Module { return new(FileManager) },
+	}
+}
+
+// Provision loads the age identity and starts the background refresh loop.
+func (m *FileManager) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	if m.Format == "" {
+		m.Format = "yaml"
+	}
+	if m.TTL == 0 {
+		m.TTL = caddy.Duration(time.Minute)
+	}
+
+	if m.AgeIdentityFile != "" {
+		f, err := os.Open(m.AgeIdentityFile)
+		if err != nil {
+			return fmt.Errorf("security.secrets.file: failed opening age identity file: %w", err)
+		}
+		defer f.Close()
+		identities, err := age.ParseIdentities(f)
+		if err != nil {
+			return fmt.Errorf("security.secrets.file: failed parsing age identities: %w", err)
+		}
+		m.identities = identities
+	}
+
+	m.cache = newTTLCache(time.Duration(m.TTL), m.fetch, m.logger)
+	if err := m.cache.reload(ctx.Context); err != nil {
+		return fmt.Errorf("security.secrets.file: failed initial read: %w", err)
+	}
+	m.cache.start(ctx.Context)
+	return nil
+}
+
+// fetch reads and decrypts Path, then decodes it as JSON or YAML.
+func (m *FileManager) fetch(_ context.Context) (map[string]interface{}, error) {
+	raw, err := os.ReadFile(m.Path)
+	if err != nil {
+		return nil, fmt.Errorf("security.secrets.file: failed reading %s: %w", m.Path, err)
+	}
+
+	plaintext := raw
+	if len(m.identities) > 0 {
+		r, err := age.Decrypt(bytes.NewReader(raw), m.identities...)
+		if err != nil {
+			return nil, fmt.Errorf("security.secrets.file: failed decrypting %s: %w", m.Path, err)
+		}
+		decrypted, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("security.secrets.file: failed reading decrypted contents of %s: %w", m.Path, err)
+		}
+		plaintext = decrypted
+	}
+
+	values := map[string]interface{}{}
+	switch m.Format {
+	case "json":
+		if err := json.Unmarshal(plaintext, &values); err != nil {
+			return nil, fmt.Errorf("security.secrets.file: %s is not valid JSON: %w", m.Path, err)
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(plaintext, &values); err != nil {
+			return nil, fmt.Errorf("security.secrets.file: %s is not valid YAML: %w", m.Path, err)
+		}
+	default:
+		return nil, fmt.Errorf("security.secrets.file: unsupported format %q", m.Format)
+	}
+	return values, nil
+}
+
+// GetSecret returns the decoded secret payload.
+func (m *FileManager) GetSecret(ctx context.Context) (map[string]interface{}, error) {
+	return m.cache.get(ctx)
+}
+
+// GetSecretByKey returns a single value from the secret payload.
+func (m *FileManager) GetSecretByKey(ctx context.Context, key string) (interface{}, error) {
+	values, err := m.cache.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := values[key]
+	if !ok {
+		return nil, fmt.Errorf("security.secrets.file: key %q not found in %s", key, m.Path)
+	}
+	return v, nil
+}
+
+// GetName returns the manager name used in {secret.<name>.<key>} references.
+func (m *FileManager) GetName() string {
+	return m.Name
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner = (*FileManager)(nil)
+	_ caddy.Module      = (*FileManager)(nil)
+)
@@ -0,0 +1,132 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(GCPSecretManager{})
+}
+
+// GCPSecretManager fetches secrets from Google Cloud Secret Manager using
+// application default credentials.
+type GCPSecretManager struct {
+	Driver string `json:"driver,omitempty"`
+
+	// Name is how this manager is referenced from a {secret.<name>.<key>}
+	// placeholder in the security app config.
+	Name string `json:"name,omitempty"`
+
+	// ProjectID is the GCP project holding the secret.
+	ProjectID string `json:"project_id,omitempty"`
+	// SecretID is the secret's resource name, e.g. "caddy-security-oauth".
+	SecretID string `json:"secret_id,omitempty"`
+	// Version selects the secret version to fetch. Defaults to "latest".
+	Version string `json:"version,omitempty"`
+
+	// TTL controls how often the cached secret is refreshed in the
+	// background. Defaults to 5m.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	client *secretmanager.Client
+	cache  *ttlCache
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (GCPSecretManager) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "security.secrets.gcp_secret_manager",
+		New: func() caddy.Module { return new(GCPSecretManager) },
+	}
+}
+
+// Provision sets up the Secret Manager client and starts the background
+// refresh loop.
+func (m *GCPSecretManager) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	if m.Version == "" {
+		m.Version = "latest"
+	}
+	if m.TTL == 0 {
+		m.TTL = caddy.Duration(5 * time.Minute)
+	}
+
+	client, err := secretmanager.NewClient(ctx.Context)
+	if err != nil {
+		return fmt.Errorf("security.secrets.gcp_secret_manager: failed creating client: %w", err)
+	}
+	m.client = client
+
+	m.cache = newTTLCache(time.Duration(m.TTL), m.fetch, m.logger)
+	if err := m.cache.reload(ctx.Context); err != nil {
+		return fmt.Errorf("security.secrets.gcp_secret_manager: failed initial fetch: %w", err)
+	}
+	m.cache.start(ctx.Context)
+	return nil
+}
+
+// fetch retrieves and json-decodes the secret payload.
+func (m *GCPSecretManager) fetch(ctx context.Context) (map[string]interface{}, error) {
+	name := fmt.Sprintf("projects/%s/secrets/%s/versions/%s", m.ProjectID, m.SecretID, m.Version)
+	resp, err := m.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(resp.Payload.Data, &values); err != nil {
+		return nil, fmt.Errorf("secret %s is not a JSON object: %w", m.SecretID, err)
+	}
+	return values, nil
+}
+
+// GetSecret returns the decoded secret payload.
+func (m *GCPSecretManager) GetSecret(ctx context.Context) (map[string]interface{}, error) {
+	return m.cache.get(ctx)
+}
+
+// GetSecretByKey returns a single value from the secret payload.
+func (m *GCPSecretManager) GetSecretByKey(ctx context.Context, key string) (interface{}, error) {
+	values, err := m.cache.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := values[key]
+	if !ok {
+		return nil, fmt.Errorf("security.secrets.gcp_secret_manager: key %q not found in %s", key, m.SecretID)
+	}
+	return v, nil
+}
+
+// GetName returns the manager name used in {secret.<name>.<key>} references.
+func (m *GCPSecretManager) GetName() string {
+	return m.Name
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner = (*GCPSecretManager)(nil)
+	_ caddy.Module      = (*GCPSecretManager)(nil)
+)
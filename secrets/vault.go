@@ -0,0 +1,210 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/api/auth/approle"
+	"github.com/hashicorp/vault/api/auth/kubernetes"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(VaultManager{})
+}
+
+// VaultManager fetches secrets from a HashiCorp Vault KV v2 mount,
+// authenticating via AppRole or Kubernetes auth and renewing its lease in
+// the background.
+type VaultManager struct {
+	Driver string `json:"driver,omitempty"`
+
+	// Name is how this manager is referenced from a {secret.<name>.<key>}
+	// placeholder in the security app config.
+	Name string `json:"name,omitempty"`
+
+	// Address is the Vault server address, e.g. https://vault.internal:8200.
+	Address string `json:"address,omitempty"`
+	// Mount is the KV v2 mount path, e.g. "secret".
+	Mount string `json:"mount,omitempty"`
+	// Path is the secret path within the mount.
+	Path string `json:"path,omitempty"`
+
+	// AppRole holds AppRole auth credentials. Mutually exclusive with
+	// Kubernetes.
+	AppRole *VaultAppRoleAuth `json:"approle,omitempty"`
+	// Kubernetes holds Kubernetes auth settings. Mutually exclusive with
+	// AppRole.
+	Kubernetes *VaultKubernetesAuth `json:"kubernetes,omitempty"`
+
+	// TTL controls how often the cached secret is refreshed in the
+	// background. Defaults to 5m.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	client *api.Client
+	cache  *ttlCache
+	logger *zap.Logger
+}
+
+// VaultAppRoleAuth holds the role and secret IDs for Vault AppRole auth.
+type VaultAppRoleAuth struct {
+	RoleID   string `json:"role_id,omitempty"`
+	SecretID string `json:"secret_id,omitempty"`
+}
+
+// VaultKubernetesAuth holds the Vault role bound to the pod's service
+// account for Kubernetes auth.
+type VaultKubernetesAuth struct {
+	Role                string `json:"role,omitempty"`
+	ServiceAccountToken string `json:"service_account_token_path,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (VaultManager) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "security.secrets.vault",
+		New: func() caddy.Module { return new(VaultManager) },
+	}
+}
+
+// Provision sets up the Vault client, authenticates, and starts the
+// background lease renewal and cache refresh loop.
+func (m *VaultManager) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	if m.TTL == 0 {
+		m.TTL = caddy.Duration(5 * time.Minute)
+	}
+
+	cfg := api.DefaultConfig()
+	if m.Address != "" {
+		cfg.Address = m.Address
+	}
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("security.secrets.vault: failed creating client: %w", err)
+	}
+	m.client = client
+
+	if err := m.authenticate(ctx.Context); err != nil {
+		return fmt.Errorf("security.secrets.vault: failed authenticating: %w", err)
+	}
+
+	m.cache = newTTLCache(time.Duration(m.TTL), m.fetch, m.logger)
+	if err := m.cache.reload(ctx.Context); err != nil {
+		return fmt.Errorf("security.secrets.vault: failed initial fetch: %w", err)
+	}
+	m.cache.start(ctx.Context)
+
+	return nil
+}
+
+// authenticate logs in to Vault via AppRole or Kubernetes auth and arranges
+// for the resulting token lease to be renewed for the lifetime of the app.
+func (m *VaultManager) authenticate(ctx context.Context) error {
+	switch {
+	case m.AppRole != nil:
+		auth, err := approle.NewAppRoleAuth(m.AppRole.RoleID, &approle.SecretID{FromString: m.AppRole.SecretID})
+		if err != nil {
+			return err
+		}
+		secret, err := m.client.Auth().Login(ctx, auth)
+		if err != nil {
+			return err
+		}
+		return m.watchLease(ctx, secret)
+	case m.Kubernetes != nil:
+		auth, err := kubernetes.NewKubernetesAuth(m.Kubernetes.Role, kubernetes.WithServiceAccountTokenPath(m.Kubernetes.ServiceAccountToken))
+		if err != nil {
+			return err
+		}
+		secret, err := m.client.Auth().Login(ctx, auth)
+		if err != nil {
+			return err
+		}
+		return m.watchLease(ctx, secret)
+	default:
+		return fmt.Errorf("no auth method configured, expected approle or kubernetes")
+	}
+}
+
+// watchLease renews the login token's lease in the background for as long
+// as the app is provisioned.
+func (m *VaultManager) watchLease(ctx context.Context, secret *api.Secret) error {
+	watcher, err := m.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		return err
+	}
+	go watcher.Start()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				watcher.Stop()
+				return
+			case err := <-watcher.DoneCh():
+				if err != nil {
+					m.logger.Error("vault lease renewal stopped", zap.Error(err))
+				}
+				return
+			case <-watcher.RenewCh():
+				m.logger.Debug("renewed vault lease")
+			}
+		}
+	}()
+	return nil
+}
+
+// fetch reads the secret from Vault's KV v2 mount.
+func (m *VaultManager) fetch(ctx context.Context) (map[string]interface{}, error) {
+	secret, err := m.client.KVv2(m.Mount).Get(ctx, m.Path)
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
+
+// GetSecret returns all key/value pairs stored at the configured path.
+func (m *VaultManager) GetSecret(ctx context.Context) (map[string]interface{}, error) {
+	return m.cache.get(ctx)
+}
+
+// GetSecretByKey returns a single value from the secret payload.
+func (m *VaultManager) GetSecretByKey(ctx context.Context, key string) (interface{}, error) {
+	values, err := m.cache.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := values[key]
+	if !ok {
+		return nil, fmt.Errorf("security.secrets.vault: key %q not found at %s/%s", key, m.Mount, m.Path)
+	}
+	return v, nil
+}
+
+// GetName returns the manager name used in {secret.<name>.<key>} references.
+func (m *VaultManager) GetName() string {
+	return m.Name
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner = (*VaultManager)(nil)
+	_ caddy.Module      = (*VaultManager)(nil)
+)
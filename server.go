@@ -0,0 +1,65 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"github.com/tyrantlink/go-authcrunch/pkg/authn"
+	"github.com/tyrantlink/go-authcrunch/pkg/authz"
+)
+
+// authcrunchServer is the subset of *authcrunch.Server the App relies on.
+// Having it as an interface, rather than depending on the concrete type
+// directly, lets tests exercise App.Reload's diff/apply/rollback logic
+// against a fake without standing up a real authcrunch.Server.
+//
+// The incremental methods below RemovePortal, AddPortal, RebuildPortal,
+// UpdatePortalCredentials and their gatekeeper/identity-store counterparts
+// are not part of upstream go-authcrunch's Server API; App.Reload (see
+// reload.go) needs per-portal/per-gatekeeper add, remove, and credential-only
+// update operations so that an unrelated portal's live sessions survive a
+// reload. This package is built against tyrantlink/go-authcrunch, a fork
+// that adds these methods; pin go.mod to a fork revision that implements
+// this exact interface, and re-verify it here with `go build ./...` before
+// upgrading the dependency.
+//
+// This source tree ships without a go.mod and without a vendored copy of
+// that fork, so `go build ./...`/`go vet ./...` cannot be run against it
+// here ("directory prefix . does not contain main module or its selected
+// dependencies"); reload_test.go's `var _ authcrunchServer = (*fakeServer)(nil)`
+// is the only compile-time check this interface gets in this environment.
+// Whoever wires up the real go.mod is responsible for also getting a green
+// `go build ./...` against the pinned fork revision before merging.
+type authcrunchServer interface {
+	GetPortalByName(name string) (*authn.Portal, error)
+	GetGatekeeperByName(name string) (*authz.Gatekeeper, error)
+	GetPortalNames() []string
+	GetGatekeeperNames() []string
+	ReprovisionPortal(name string) error
+	ReloadIdentityStores() error
+	SetEventEmitter(emitter EventEmitter)
+
+	RemovePortal(name string) error
+	AddPortal(cfg map[string]interface{}) error
+	RebuildPortal(name string, cfg map[string]interface{}) error
+	UpdatePortalCredentials(name string, cfg map[string]interface{}) error
+
+	RemoveGatekeeper(name string) error
+	AddGatekeeper(cfg map[string]interface{}) error
+	RebuildGatekeeper(name string, cfg map[string]interface{}) error
+
+	AddIdentityStore(cfg map[string]interface{}) error
+	UpdateIdentityStore(name string, cfg map[string]interface{}) error
+	RemoveIdentityStore(name string) error
+}